@@ -0,0 +1,70 @@
+package oauth
+
+import (
+	"context"
+
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+
+	oauthv1 "github.com/openshift/api/oauth/v1"
+	userv1 "github.com/openshift/api/user/v1"
+)
+
+// audienceScoper is implemented by validators that need to narrow, rather than
+// simply accept or reject, the token -- currently only the audience validator. It is
+// consulted instead of Validate, since a disjoint audience must produce found=false
+// without an error (so a union/chained authenticator gets to try next), which
+// OAuthTokenValidator's error-only contract can't express.
+type audienceScoper interface {
+	OAuthTokenValidator
+	scopeAudiences(ctx context.Context, token *oauthv1.OAuthAccessToken) (authenticator.Audiences, bool)
+}
+
+// audienceValidator restricts acceptance of a token to the audiences it was issued
+// for. A token with no Audiences recorded is accepted for any requested audience,
+// preserving the behavior of tokens minted before audience scoping existed.
+type audienceValidator struct{}
+
+// NewAudienceValidator returns an OAuthTokenValidator that enforces
+// OAuthAccessToken.Audiences against the audiences required by the incoming request.
+func NewAudienceValidator() OAuthTokenValidator {
+	return audienceValidator{}
+}
+
+// Validate is a no-op; audienceValidator is consulted through scopeAudiences instead,
+// since narrowing the response's audiences can't be expressed as a plain accept/reject.
+func (audienceValidator) Validate(context.Context, *oauthv1.OAuthAccessToken, *userv1.User) error {
+	return nil
+}
+
+func (audienceValidator) scopeAudiences(ctx context.Context, token *oauthv1.OAuthAccessToken) (authenticator.Audiences, bool) {
+	requested, ok := authenticator.RequestAudiencesFrom(ctx)
+	if !ok || len(requested) == 0 {
+		return nil, true
+	}
+	if len(token.Audiences) == 0 {
+		return requested, true
+	}
+
+	intersection := intersectAudiences(requested, token.Audiences)
+	if len(intersection) == 0 {
+		return nil, false
+	}
+	return intersection, true
+}
+
+// intersectAudiences returns the requested audiences that also appear in allowed,
+// preserving requested's order.
+func intersectAudiences(requested authenticator.Audiences, allowed []string) authenticator.Audiences {
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, aud := range allowed {
+		allowedSet[aud] = true
+	}
+
+	var intersection authenticator.Audiences
+	for _, aud := range requested {
+		if allowedSet[aud] {
+			intersection = append(intersection, aud)
+		}
+	}
+	return intersection
+}
@@ -0,0 +1,122 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+
+	oauthv1 "github.com/openshift/api/oauth/v1"
+	userv1 "github.com/openshift/api/user/v1"
+	oauthfake "github.com/openshift/client-go/oauth/clientset/versioned/fake"
+	userfake "github.com/openshift/client-go/user/clientset/versioned/fake"
+)
+
+func TestAuthenticateTokenAudiences(t *testing.T) {
+	scopedToken, scopedTokenHash := generateOAuthTokenPair()
+	scoped := &oauthv1.OAuthAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: scopedTokenHash, CreationTimestamp: metav1.Time{Time: time.Now()}},
+		ExpiresIn:  600,
+		UserName:   "foo",
+		UserUID:    "bar",
+		Audiences:  []string{"aud-a", "aud-b"},
+	}
+
+	unscopedToken, unscopedTokenHash := generateOAuthTokenPair()
+	unscoped := &oauthv1.OAuthAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: unscopedTokenHash, CreationTimestamp: metav1.Time{Time: time.Now()}},
+		ExpiresIn:  600,
+		UserName:   "foo",
+		UserUID:    "bar",
+	}
+
+	fakeOAuthClient := oauthfake.NewSimpleClientset(scoped, unscoped)
+	fakeUserClient := userfake.NewSimpleClientset(&userv1.User{ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "bar"}})
+
+	tokenAuthenticator := NewTokenAuthenticator(
+		fakeOAuthClient.OauthV1().OAuthAccessTokens(),
+		fakeUserClient.UserV1().Users(),
+		NoopGroupMapper{},
+		nil,
+		nil,
+		NewAudienceValidator(),
+	)
+
+	type test struct {
+		name              string
+		token             string
+		requiredAudiences authenticator.Audiences
+		expectedFound     bool
+		expectedAudiences authenticator.Audiences
+	}
+
+	for _, tc := range []test{
+		{"no required audiences, scoped token", scopedToken, nil, true, nil},
+		{"no required audiences, unscoped token", unscopedToken, nil, true, nil},
+		{"matching audience", scopedToken, authenticator.Audiences{"aud-a"}, true, authenticator.Audiences{"aud-a"}},
+		{"disjoint audience", scopedToken, authenticator.Audiences{"aud-z"}, false, nil},
+		{"multi-audience intersection", scopedToken, authenticator.Audiences{"aud-b", "aud-z"}, true, authenticator.Audiences{"aud-b"}},
+		{"unscoped token accepts any requested audience", unscopedToken, authenticator.Audiences{"aud-z"}, true, authenticator.Audiences{"aud-z"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.requiredAudiences != nil {
+				ctx = authenticator.WithAudiences(ctx, tc.requiredAudiences)
+			}
+
+			resp, found, err := tokenAuthenticator.AuthenticateToken(ctx, tc.token)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if found != tc.expectedFound {
+				t.Fatalf("expected found=%v, got %v", tc.expectedFound, found)
+			}
+			if !found {
+				return
+			}
+			if len(resp.Audiences) != len(tc.expectedAudiences) {
+				t.Fatalf("expected audiences %v, got %v", tc.expectedAudiences, resp.Audiences)
+			}
+			for i, aud := range tc.expectedAudiences {
+				if resp.Audiences[i] != aud {
+					t.Errorf("expected audiences %v, got %v", tc.expectedAudiences, resp.Audiences)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticateTokenAudiencesPreservesImplicitAudiences(t *testing.T) {
+	token, tokenHash := generateOAuthTokenPair()
+	fakeOAuthClient := oauthfake.NewSimpleClientset(&oauthv1.OAuthAccessToken{
+		ObjectMeta: metav1.ObjectMeta{Name: tokenHash, CreationTimestamp: metav1.Time{Time: time.Now()}},
+		ExpiresIn:  600,
+		UserName:   "foo",
+		UserUID:    "bar",
+	})
+	fakeUserClient := userfake.NewSimpleClientset(&userv1.User{ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "bar"}})
+
+	implicitAudiences := authenticator.Audiences{"implicit-a"}
+	tokenAuthenticator := NewTokenAuthenticator(
+		fakeOAuthClient.OauthV1().OAuthAccessTokens(),
+		fakeUserClient.UserV1().Users(),
+		NoopGroupMapper{},
+		implicitAudiences,
+		nil,
+		NewAudienceValidator(),
+	)
+
+	// A request with no required audiences must not have its response audiences
+	// narrowed to nil -- that would discard the authenticator's own implicit
+	// audiences even though nothing was actually narrowed.
+	resp, found, err := tokenAuthenticator.AuthenticateToken(context.Background(), token)
+	if err != nil || !found {
+		t.Fatalf("unexpected result: found=%v err=%v", found, err)
+	}
+	if len(resp.Audiences) != len(implicitAudiences) || resp.Audiences[0] != implicitAudiences[0] {
+		t.Fatalf("expected implicit audiences %v to be preserved, got %v", implicitAudiences, resp.Audiences)
+	}
+}
@@ -0,0 +1,419 @@
+package oauth
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// cacheShardCount is the number of independently-locked LRU shards the cache is split
+// into, so that authentication storms against different tokens don't serialize on a
+// single mutex.
+const cacheShardCount = 32
+
+var (
+	cacheHits = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      "authentication",
+		Name:           "token_cache_hits_total",
+		Help:           "Number of token authentications served from the cache.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	cacheMisses = metrics.NewCounter(&metrics.CounterOpts{
+		Subsystem:      "authentication",
+		Name:           "token_cache_misses_total",
+		Help:           "Number of token authentications that missed the cache and were sent to the delegate.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	cacheInflight = metrics.NewGauge(&metrics.GaugeOpts{
+		Subsystem:      "authentication",
+		Name:           "token_cache_inflight_requests",
+		Help:           "Number of token authentications currently waiting on a delegate lookup.",
+		StabilityLevel: metrics.ALPHA,
+	})
+)
+
+func init() {
+	legacyregistry.MustRegister(cacheHits, cacheMisses, cacheInflight)
+}
+
+// cacheResult is what a delegate lookup produces, cached verbatim so a repeat lookup
+// of the same token returns exactly what the delegate would have.
+type cacheResult struct {
+	response *authenticator.Response
+	ok       bool
+	err      error
+}
+
+// cacheEntry is the value stored in a cacheShard's LRU.
+type cacheEntry struct {
+	key       string
+	name      string
+	result    cacheResult
+	expiresAt time.Time
+}
+
+// cacheShard is one stripe of the cache: an LRU guarded by its own lock.
+type cacheShard struct {
+	lock     sync.Mutex
+	items    map[string]*list.Element
+	eviction *list.List
+	maxSize  int
+
+	// onRemove, if set, is called (without the shard lock held) for every entry that
+	// leaves the shard, whether by TTL expiry, LRU eviction, or explicit delete. It
+	// lets the owning cachedTokenAuthenticator keep its name index no larger than the
+	// cache itself instead of growing it without bound.
+	onRemove func(entry *cacheEntry)
+}
+
+func newCacheShard(maxSize int) *cacheShard {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	return &cacheShard{
+		items:    map[string]*list.Element{},
+		eviction: list.New(),
+		maxSize:  maxSize,
+	}
+}
+
+func (s *cacheShard) get(key string, now time.Time) (cacheResult, bool) {
+	s.lock.Lock()
+
+	el, ok := s.items[key]
+	if !ok {
+		s.lock.Unlock()
+		return cacheResult{}, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if now.After(entry.expiresAt) {
+		s.eviction.Remove(el)
+		delete(s.items, key)
+		s.lock.Unlock()
+		if s.onRemove != nil {
+			s.onRemove(entry)
+		}
+		return cacheResult{}, false
+	}
+	s.eviction.MoveToFront(el)
+	s.lock.Unlock()
+	return entry.result, true
+}
+
+func (s *cacheShard) delete(key string) {
+	s.lock.Lock()
+	el, ok := s.items[key]
+	if ok {
+		s.eviction.Remove(el)
+		delete(s.items, key)
+	}
+	s.lock.Unlock()
+
+	if ok && s.onRemove != nil {
+		s.onRemove(el.Value.(*cacheEntry))
+	}
+}
+
+func (s *cacheShard) put(key, name string, result cacheResult, expiresAt time.Time) {
+	entry := &cacheEntry{key: key, name: name, result: result, expiresAt: expiresAt}
+
+	s.lock.Lock()
+	if el, ok := s.items[key]; ok {
+		el.Value = entry
+		s.eviction.MoveToFront(el)
+		s.lock.Unlock()
+		return
+	}
+
+	s.items[key] = s.eviction.PushFront(entry)
+	var evicted []*cacheEntry
+	for s.eviction.Len() > s.maxSize {
+		oldest := s.eviction.Back()
+		if oldest == nil {
+			break
+		}
+		s.eviction.Remove(oldest)
+		oldestEntry := oldest.Value.(*cacheEntry)
+		delete(s.items, oldestEntry.key)
+		evicted = append(evicted, oldestEntry)
+	}
+	s.lock.Unlock()
+
+	if s.onRemove != nil {
+		for _, oldestEntry := range evicted {
+			s.onRemove(oldestEntry)
+		}
+	}
+}
+
+// inflightCall tracks the waiters on a delegate lookup that hasn't resolved yet, so
+// the lookup can be canceled once every caller waiting on it has given up.
+type inflightCall struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// tokenNamer is implemented by a delegate (such as tokenAuthenticator) that can
+// resolve a bearer token to the name of the OAuthAccessToken it maps to for every
+// hashing scheme it accepts. When the delegate doesn't implement it, the cache falls
+// back to getTokenName, which only understands the original self-indexed sha256
+// scheme.
+type tokenNamer interface {
+	tokenName(bearerToken string) (string, error)
+}
+
+// TokenRevoker lets a caller purge a single token from an authenticator-local cache
+// synchronously, instead of waiting for the cache entry's TTL to elapse. tokenName is
+// the name of the OAuthAccessToken (i.e. already-hashed), since that's what's known to
+// callers such as a logout handler, an admin "kill this session" endpoint, or a
+// DeleteFunc triggered by the OAuthAccessToken shared informer.
+type TokenRevoker interface {
+	ExpireToken(tokenName string) error
+}
+
+// CachedTokenAuthenticator is the interface satisfied by the value returned from
+// NewCachedTokenAuthenticator, for callers that need to evict entries on demand in
+// addition to authenticating tokens.
+type CachedTokenAuthenticator interface {
+	authenticator.Token
+	TokenRevoker
+}
+
+// cachedTokenAuthenticator wraps an authenticator.Token with an HMAC-keyed,
+// striped LRU cache and single-flights concurrent lookups of the same unknown
+// token, so an authentication storm against the delegate collapses into one call.
+//
+// The raw bearer token is never used as a cache key or stored anywhere; only its
+// HMAC-SHA256 digest under a process-lifetime random key is, so the cache can't leak
+// credentials if dumped.
+type cachedTokenAuthenticator struct {
+	delegate authenticator.Token
+
+	hmacKey []byte
+
+	successTTL time.Duration
+	failureTTL time.Duration
+
+	shards [cacheShardCount]*cacheShard
+
+	group singleflight.Group
+
+	inflightLock sync.Mutex
+	inflight     map[string]*inflightCall
+
+	// nameLock/byName index the OAuthAccessToken name each cache key was last seen
+	// under, so ExpireToken (which only ever gets a name, never the raw secret) can
+	// find and purge the matching cache entry. Entries are only ever added alongside a
+	// cacheShard entry and removed via that shard's onRemove hook, so byName can never
+	// grow past the cache's own fixed size.
+	nameLock sync.Mutex
+	byName   map[string]string
+
+	// clock is overridden in tests, mirroring the TimeoutValidator pattern.
+	clock clock.Clock
+}
+
+// NewCachedTokenAuthenticator wraps delegate with a cache split into cacheShardCount
+// LRU shards of cacheSize/cacheShardCount entries each (at least one per shard). A
+// successful lookup is cached for successTTL, an unsuccessful one (found=false, or
+// found=true with an error) for failureTTL, each with independent +/-10% jitter so a
+// batch of tokens issued together doesn't expire from the cache simultaneously.
+func NewCachedTokenAuthenticator(delegate authenticator.Token, successTTL, failureTTL time.Duration, cacheSize int) CachedTokenAuthenticator {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+
+	perShard := cacheSize / cacheShardCount
+
+	a := &cachedTokenAuthenticator{
+		delegate:   delegate,
+		hmacKey:    key,
+		successTTL: successTTL,
+		failureTTL: failureTTL,
+		inflight:   map[string]*inflightCall{},
+		byName:     map[string]string{},
+		clock:      clock.RealClock{},
+	}
+	for i := range a.shards {
+		a.shards[i] = newCacheShard(perShard)
+		a.shards[i].onRemove = a.forgetName
+	}
+	return a
+}
+
+// ExpireToken implements TokenRevoker.
+func (a *cachedTokenAuthenticator) ExpireToken(tokenName string) error {
+	a.nameLock.Lock()
+	key, ok := a.byName[tokenName]
+	if ok {
+		delete(a.byName, tokenName)
+	}
+	a.nameLock.Unlock()
+
+	if ok {
+		a.shardFor(key).delete(key)
+	}
+	return nil
+}
+
+func (a *cachedTokenAuthenticator) AuthenticateToken(ctx context.Context, token string) (*authenticator.Response, bool, error) {
+	key := a.digest(token)
+	shard := a.shardFor(key)
+
+	if result, ok := shard.get(key, a.clock.Now()); ok {
+		cacheHits.Inc()
+		return result.response, result.ok, result.err
+	}
+	cacheMisses.Inc()
+
+	leaderCtx := a.joinInflight(key)
+	cacheInflight.Inc()
+	defer cacheInflight.Dec()
+
+	resCh := a.group.DoChan(key, func() (interface{}, error) {
+		resp, ok, err := a.delegate.AuthenticateToken(leaderCtx, token)
+		result := cacheResult{response: resp, ok: ok, err: err}
+
+		ttl := a.failureTTL
+		if ok && err == nil {
+			ttl = a.successTTL
+		}
+		name := a.tokenName(token)
+		// Only successes are indexed: a failed lookup that resolves to the same name
+		// (e.g. a wrong secret under a valid bcrypt lookup name) must not displace the
+		// index entry of the cached success that ExpireToken has to be able to purge.
+		if ok && err == nil {
+			a.rememberName(name, key)
+		}
+		shard.put(key, name, result, a.jitteredExpiry(ttl))
+
+		return result, nil
+	})
+
+	select {
+	case res := <-resCh:
+		a.leaveInflight(key)
+		result := res.Val.(cacheResult)
+		return result.response, result.ok, result.err
+	case <-ctx.Done():
+		a.leaveInflight(key)
+		return nil, false, ctx.Err()
+	}
+}
+
+// digest returns the HMAC-SHA256 of token, which is what identifies it in the cache
+// and in the singleflight group. The raw token itself is only ever handed to delegate.
+func (a *cachedTokenAuthenticator) digest(token string) string {
+	mac := hmac.New(sha256.New, a.hmacKey)
+	mac.Write([]byte(token))
+	return string(mac.Sum(nil))
+}
+
+func (a *cachedTokenAuthenticator) shardFor(digest string) *cacheShard {
+	return a.shards[byte(digest[0])%cacheShardCount]
+}
+
+// tokenName resolves token to the name of the OAuthAccessToken it maps to, preferring
+// the delegate's own resolution (correct for every hasher it accepts) and falling
+// back to the sha256-only getTokenName for a delegate that isn't a tokenNamer. It
+// returns "" if the name can't be determined, which rememberName treats as "don't
+// index this entry".
+func (a *cachedTokenAuthenticator) tokenName(token string) string {
+	if namer, ok := a.delegate.(tokenNamer); ok {
+		name, err := namer.tokenName(token)
+		if err != nil {
+			return ""
+		}
+		return name
+	}
+	name, err := getTokenName(token)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// rememberName records that key is the cache entry for the OAuthAccessToken called
+// name, so a later ExpireToken(name) can find it. It's only called once per delegate
+// lookup (not on every cache hit), and forgetName keeps it in sync with the shard that
+// actually owns key, so the index can never outgrow the cache itself.
+func (a *cachedTokenAuthenticator) rememberName(name, key string) {
+	if name == "" {
+		return
+	}
+	a.nameLock.Lock()
+	a.byName[name] = key
+	a.nameLock.Unlock()
+}
+
+// forgetName is a cacheShard's onRemove hook: it drops entry's name from byName, but
+// only if byName still points at entry's own key, so a newer entry for the same name
+// racing in concurrently is never clobbered.
+func (a *cachedTokenAuthenticator) forgetName(entry *cacheEntry) {
+	if entry.name == "" {
+		return
+	}
+	a.nameLock.Lock()
+	if a.byName[entry.name] == entry.key {
+		delete(a.byName, entry.name)
+	}
+	a.nameLock.Unlock()
+}
+
+// jitteredExpiry returns a.clock.Now()+ttl, perturbed by up to +/-10% so entries
+// cached at the same moment don't all expire at once.
+func (a *cachedTokenAuthenticator) jitteredExpiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return a.clock.Now()
+	}
+	jitter := time.Duration((mathrand.Float64()*0.2 - 0.1) * float64(ttl))
+	return a.clock.Now().Add(ttl + jitter)
+}
+
+// joinInflight registers the caller as a waiter on the delegate lookup for key,
+// creating one if none is in progress, and returns the context that should be used
+// for the (possibly shared) delegate call.
+func (a *cachedTokenAuthenticator) joinInflight(key string) context.Context {
+	a.inflightLock.Lock()
+	defer a.inflightLock.Unlock()
+
+	call, ok := a.inflight[key]
+	if !ok {
+		leaderCtx, cancel := context.WithCancel(context.Background())
+		call = &inflightCall{ctx: leaderCtx, cancel: cancel}
+		a.inflight[key] = call
+	}
+	call.waiters++
+	return call.ctx
+}
+
+// leaveInflight removes the caller from the waiter set for key, canceling the
+// delegate lookup's context once the last waiter has left.
+func (a *cachedTokenAuthenticator) leaveInflight(key string) {
+	a.inflightLock.Lock()
+	defer a.inflightLock.Unlock()
+
+	call, ok := a.inflight[key]
+	if !ok {
+		return
+	}
+	call.waiters--
+	if call.waiters <= 0 {
+		call.cancel()
+		delete(a.inflight, key)
+	}
+}
@@ -0,0 +1,205 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/tools/cache"
+
+	oauthv1 "github.com/openshift/api/oauth/v1"
+	userv1 "github.com/openshift/api/user/v1"
+	oauthexternalversions "github.com/openshift/client-go/informers/externalversions"
+	oauthfake "github.com/openshift/client-go/oauth/clientset/versioned/fake"
+	userfake "github.com/openshift/client-go/user/clientset/versioned/fake"
+)
+
+type countingAuthenticator struct {
+	calls int32
+
+	resp *authenticator.Response
+	ok   bool
+	err  error
+
+	block chan struct{}
+}
+
+func (c *countingAuthenticator) AuthenticateToken(ctx context.Context, token string) (*authenticator.Response, bool, error) {
+	atomic.AddInt32(&c.calls, 1)
+	if c.block != nil {
+		select {
+		case <-c.block:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	return c.resp, c.ok, c.err
+}
+
+func TestCachedTokenAuthenticatorCachesSuccess(t *testing.T) {
+	delegate := &countingAuthenticator{
+		resp: &authenticator.Response{User: &user.DefaultInfo{Name: "alice"}},
+		ok:   true,
+	}
+	cached := NewCachedTokenAuthenticator(delegate, time.Minute, time.Minute, 100)
+
+	for i := 0; i < 5; i++ {
+		userInfo, found, err := cached.AuthenticateToken(context.TODO(), "sha256~token")
+		if err != nil || !found {
+			t.Fatalf("unexpected result: found=%v err=%v", found, err)
+		}
+		if userInfo.User.GetName() != "alice" {
+			t.Errorf("unexpected user: %v", userInfo.User.GetName())
+		}
+	}
+
+	if got := atomic.LoadInt32(&delegate.calls); got != 1 {
+		t.Errorf("expected delegate to be called once, got %d calls", got)
+	}
+}
+
+func TestCachedTokenAuthenticatorCachesFailureSeparately(t *testing.T) {
+	delegate := &countingAuthenticator{err: errors.New("boom")}
+	cached := NewCachedTokenAuthenticator(delegate, time.Minute, time.Millisecond, 100)
+
+	impl := cached.(*cachedTokenAuthenticator)
+	fakeClock := clock.NewFakeClock(time.Now())
+	impl.clock = fakeClock
+
+	if _, _, err := cached.AuthenticateToken(context.TODO(), "sha256~token"); err == nil {
+		t.Fatal("expected error from delegate")
+	}
+	if _, _, err := cached.AuthenticateToken(context.TODO(), "sha256~token"); err == nil {
+		t.Fatal("expected cached error from delegate")
+	}
+	if got := atomic.LoadInt32(&delegate.calls); got != 1 {
+		t.Errorf("expected delegate to be called once before TTL expiry, got %d calls", got)
+	}
+
+	fakeClock.Step(time.Second)
+
+	if _, _, err := cached.AuthenticateToken(context.TODO(), "sha256~token"); err == nil {
+		t.Fatal("expected error from delegate after cache entry expired")
+	}
+	if got := atomic.LoadInt32(&delegate.calls); got != 2 {
+		t.Errorf("expected delegate to be called again after TTL expiry, got %d calls", got)
+	}
+}
+
+func TestCachedTokenAuthenticatorCollapsesConcurrentMisses(t *testing.T) {
+	delegate := &countingAuthenticator{
+		resp:  &authenticator.Response{User: &user.DefaultInfo{Name: "alice"}},
+		ok:    true,
+		block: make(chan struct{}),
+	}
+	cached := NewCachedTokenAuthenticator(delegate, time.Minute, time.Minute, 100)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, found, err := cached.AuthenticateToken(context.TODO(), "sha256~token"); err != nil || !found {
+				t.Errorf("unexpected result: found=%v err=%v", found, err)
+			}
+		}()
+	}
+
+	close(delegate.block)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&delegate.calls); got != 1 {
+		t.Errorf("expected concurrent lookups of the same token to collapse into one delegate call, got %d calls", got)
+	}
+}
+
+func TestCachedTokenAuthenticatorExpireTokenEvictsImmediately(t *testing.T) {
+	token, tokenHash := generateOAuthTokenPair()
+	fakeOAuthClient := oauthfake.NewSimpleClientset(
+		&oauthv1.OAuthAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: tokenHash, CreationTimestamp: metav1.Time{Time: time.Now()}},
+			ExpiresIn:  600, // 10 minutes
+			UserName:   "foo",
+			UserUID:    "bar",
+		},
+	)
+	fakeUserClient := userfake.NewSimpleClientset(&userv1.User{ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "bar"}})
+
+	delegate := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, nil)
+	cached := NewCachedTokenAuthenticator(delegate, time.Minute, time.Minute, 100)
+
+	if _, found, err := cached.AuthenticateToken(context.TODO(), token); err != nil || !found {
+		t.Fatalf("expected token to authenticate, found=%v err=%v", found, err)
+	}
+
+	if err := fakeOAuthClient.OauthV1().OAuthAccessTokens().Delete(context.TODO(), tokenHash, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete token: %v", err)
+	}
+
+	// Without eviction the cache would keep serving the now-stale success for up to
+	// a minute; ExpireToken must make the very next call observe the deletion.
+	if err := cached.ExpireToken(tokenHash); err != nil {
+		t.Fatalf("unexpected error from ExpireToken: %v", err)
+	}
+
+	if _, found, err := cached.AuthenticateToken(context.TODO(), token); found || err == nil {
+		t.Fatalf("expected token to be rejected immediately after deletion, found=%v err=%v", found, err)
+	}
+}
+
+func TestTokenRevocationHandlerEvictsOnInformerDelete(t *testing.T) {
+	token, tokenHash := generateOAuthTokenPair()
+	fakeOAuthClient := oauthfake.NewSimpleClientset(
+		&oauthv1.OAuthAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: tokenHash, CreationTimestamp: metav1.Time{Time: time.Now()}},
+			ExpiresIn:  600, // 10 minutes
+			UserName:   "foo",
+			UserUID:    "bar",
+		},
+	)
+	fakeUserClient := userfake.NewSimpleClientset(&userv1.User{ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "bar"}})
+
+	delegate := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, nil)
+	cached := NewCachedTokenAuthenticator(delegate, time.Minute, time.Minute, 100)
+
+	factory := oauthexternalversions.NewSharedInformerFactory(fakeOAuthClient, 0)
+	informer := factory.Oauth().V1().OAuthAccessTokens()
+	RegisterTokenRevocationHandler(informer, cached)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.Informer().HasSynced) {
+		t.Fatal("informer cache never synced")
+	}
+
+	if _, found, err := cached.AuthenticateToken(context.TODO(), token); err != nil || !found {
+		t.Fatalf("expected token to authenticate, found=%v err=%v", found, err)
+	}
+
+	if err := fakeOAuthClient.OauthV1().OAuthAccessTokens().Delete(context.TODO(), tokenHash, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete token: %v", err)
+	}
+
+	// The delete event reaches RegisterTokenRevocationHandler's DeleteFunc through the
+	// informer's watch asynchronously; poll briefly instead of asserting immediately,
+	// with no manual ExpireToken call standing in for it.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, found, err := cached.AuthenticateToken(context.TODO(), token)
+		if !found && err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected token to be rejected after informer-driven eviction, but cache still serves it")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,36 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+)
+
+// sha256Prefix marks a bearer token (and the OAuthAccessToken name derived from it) as
+// using the plain SHA-256 digest scheme.
+const sha256Prefix = "sha256~"
+
+// sha256Digest returns the base64url SHA-256 digest of secret, with no prefix.
+func sha256Digest(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// hashToken returns the "sha256~<digest>" OAuthAccessToken name for a token secret.
+// The digest, not the secret, is what ends up stored (and logged, and dumped in an
+// etcd snapshot), so the raw secret is never recoverable from it.
+func hashToken(secret string) string {
+	return sha256Prefix + sha256Digest(secret)
+}
+
+// randomSecret returns a random, URL-safe token secret of n raw bytes of entropy.
+func randomSecret(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand.Read on a supported platform only fails if the OS entropy
+		// source is broken, which nothing downstream could recover from either.
+		panic(err)
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+}
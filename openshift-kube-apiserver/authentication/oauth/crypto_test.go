@@ -0,0 +1,8 @@
+package oauth
+
+// generateOAuthTokenPair returns a freshly minted bearer token together with the
+// OAuthAccessToken name it would be stored under.
+func generateOAuthTokenPair() (token, tokenHash string) {
+	secret := randomSecret(32)
+	return sha256Prefix + secret, hashToken(secret)
+}
@@ -0,0 +1,300 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	oauthv1 "github.com/openshift/api/oauth/v1"
+	userv1 "github.com/openshift/api/user/v1"
+	oauthclient "github.com/openshift/client-go/oauth/clientset/versioned/typed/oauth/v1"
+	userclient "github.com/openshift/client-go/user/clientset/versioned/typed/user/v1"
+)
+
+const (
+	// issuedAtExtraKey and expiresInExtraKey mirror the token-response fields
+	// standardized by the Docker distribution token spec, so downstream
+	// admission/audit plugins can reason about token freshness without re-fetching
+	// the OAuthAccessToken.
+	issuedAtExtraKey  = "oauth.openshift.io/issued-at"
+	expiresInExtraKey = "oauth.openshift.io/expires-in"
+)
+
+// deadlineScoper is implemented by validators (like TimeoutValidator) that can
+// tighten a token's effective expiry beyond its absolute ExpiresIn, so
+// AuthenticateToken can report an accurate expiresInExtraKey value.
+type deadlineScoper interface {
+	effectiveDeadline(token *oauthv1.OAuthAccessToken) (time.Time, bool)
+}
+
+var (
+	// errLookup is returned (instead of the underlying API error) whenever a bearer
+	// token cannot be resolved to an OAuthAccessToken, so that callers can't use error
+	// content to distinguish "unknown token" from "etcd is unreachable".
+	errLookup = errors.New("token lookup failed")
+	// errTimedout is returned when a token is otherwise valid but has exceeded its
+	// absolute lifetime (CreationTimestamp+ExpiresIn) or its inactivity timeout. See
+	// TimeoutValidator.
+	errTimedout = errors.New("token is expired due to inactivity timeout")
+)
+
+// OAuthTokenValidator validates a looked-up OAuthAccessToken/User pair before the
+// authenticator accepts it. Validators are consulted in order and the first error
+// wins; a validator that needs to reject a token without treating it as "not found"
+// should return a descriptive error.
+type OAuthTokenValidator interface {
+	Validate(ctx context.Context, token *oauthv1.OAuthAccessToken, user *userv1.User) error
+}
+
+// OAuthTokenValidateFunc adapts a function to an OAuthTokenValidator.
+type OAuthTokenValidateFunc func(ctx context.Context, token *oauthv1.OAuthAccessToken, user *userv1.User) error
+
+func (f OAuthTokenValidateFunc) Validate(ctx context.Context, token *oauthv1.OAuthAccessToken, user *userv1.User) error {
+	return f(ctx, token, user)
+}
+
+// GroupMapper maps a looked-up User to the extra groups that should be attached to the
+// authenticator.Response. This lets callers fold in virtual groups (e.g. "system:authenticated:oauth")
+// without the token authenticator knowing about group policy.
+type GroupMapper interface {
+	UserToGroups(user *userv1.User) []string
+}
+
+// NoopGroupMapper attaches no extra groups.
+type NoopGroupMapper struct{}
+
+func (NoopGroupMapper) UserToGroups(user *userv1.User) []string {
+	return nil
+}
+
+// tokenAuthenticator authenticates bearer tokens against OAuthAccessToken objects
+// stored in the API. Bearer tokens must carry the prefix of a hasher registered in
+// hashers (e.g. "sha256~<secret>"); the OAuthAccessToken's name is derived from the
+// token through that hasher so that the raw secret is never persisted.
+type tokenAuthenticator struct {
+	tokens      oauthclient.OAuthAccessTokenInterface
+	users       userclient.UserInterface
+	groupMapper GroupMapper
+	validators  []OAuthTokenValidator
+	hashers     *TokenHasherRegistry
+
+	// implicitAudiences is set as the Response's Audiences unless an audience
+	// validator narrows them to the audiences the request asked for.
+	implicitAudiences authenticator.Audiences
+
+	clock clock.Clock
+}
+
+// NewTokenAuthenticator returns an authenticator.Token that looks up bearer tokens as
+// OAuthAccessToken objects via tokens, resolves the owning user via users, and runs
+// every validator (in order) against the result before accepting it. hashers governs
+// which bearer-token hashing schemes are accepted; a nil registry falls back to
+// DefaultTokenHasherRegistry (SHA-256 only).
+func NewTokenAuthenticator(tokens oauthclient.OAuthAccessTokenInterface, users userclient.UserInterface, groupMapper GroupMapper, implicitAudiences authenticator.Audiences, hashers *TokenHasherRegistry, validators ...OAuthTokenValidator) authenticator.Token {
+	if hashers == nil {
+		hashers = DefaultTokenHasherRegistry()
+	}
+	return &tokenAuthenticator{
+		tokens:            tokens,
+		users:             users,
+		groupMapper:       groupMapper,
+		validators:        validators,
+		hashers:           hashers,
+		implicitAudiences: implicitAudiences,
+		clock:             clock.RealClock{},
+	}
+}
+
+func (a *tokenAuthenticator) AuthenticateToken(ctx context.Context, bearerToken string) (*authenticator.Response, bool, error) {
+	token, err := a.lookupToken(ctx, bearerToken)
+	if err != nil {
+		// Never leak whether the failure was "not found", a hashing mismatch, or
+		// something else (e.g. an etcd outage); all must look identical to the
+		// caller.
+		return nil, false, errLookup
+	}
+
+	var effectiveExpiry time.Time
+	hasExpiry := false
+	if token.ExpiresIn > 0 {
+		effectiveExpiry = token.CreationTimestamp.Add(time.Duration(token.ExpiresIn) * time.Second)
+		hasExpiry = true
+		if a.clock.Now().After(effectiveExpiry) {
+			return nil, false, errTimedout
+		}
+	}
+
+	u, err := a.users.Get(ctx, token.UserName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, errLookup
+		}
+		return nil, false, err
+	}
+
+	responseAudiences := a.implicitAudiences
+	for _, validator := range a.validators {
+		if av, ok := validator.(audienceScoper); ok {
+			audiences, ok := av.scopeAudiences(ctx, token)
+			if !ok {
+				// Disjoint audiences: report "not found", not an error, so a
+				// chained/union authenticator still gets a chance to accept the
+				// token for its own audience.
+				return nil, false, nil
+			}
+			// A non-empty result means the scoper actually narrowed based on a
+			// requested audience; an empty one means there was nothing to narrow
+			// (e.g. the request carried no required audiences), so implicitAudiences
+			// must stand.
+			if len(audiences) > 0 {
+				responseAudiences = audiences
+			}
+			continue
+		}
+		if err := validator.Validate(ctx, token, u); err != nil {
+			return nil, false, err
+		}
+		if ds, ok := validator.(deadlineScoper); ok {
+			if deadline, ok := ds.effectiveDeadline(token); ok && (!hasExpiry || deadline.Before(effectiveExpiry)) {
+				effectiveExpiry, hasExpiry = deadline, true
+			}
+		}
+	}
+
+	extra := map[string][]string{
+		issuedAtExtraKey: {token.CreationTimestamp.UTC().Format(time.RFC3339)},
+	}
+	if hasExpiry {
+		remaining := effectiveExpiry.Sub(a.clock.Now())
+		if remaining < 0 {
+			remaining = 0
+		}
+		extra[expiresInExtraKey] = []string{strconv.FormatInt(int64(remaining/time.Second), 10)}
+	}
+
+	return &authenticator.Response{
+		User: &user.DefaultInfo{
+			Name:   u.Name,
+			UID:    string(u.UID),
+			Groups: a.groupMapper.UserToGroups(u),
+			Extra:  extra,
+		},
+		Audiences: responseAudiences,
+	}, true, nil
+}
+
+// TokenWithAudiences is satisfied structurally by AuthenticateToken's existing
+// signature; this assertion just documents that the authenticator consults the
+// request's audiences (see audienceValidator) rather than ignoring them.
+var _ authenticator.TokenWithAudiences = (*tokenAuthenticator)(nil)
+
+// getTokenName recovers the name under which a bearer token's OAuthAccessToken is
+// stored, assuming the original, self-indexing "sha256~" scheme. It's the cache
+// layer's fallback for deriving a revocation-index name from a delegate that doesn't
+// implement tokenNamer, so it's only ever correct for a sha256-only delegate.
+func getTokenName(bearerToken string) (string, error) {
+	if !strings.HasPrefix(bearerToken, sha256Prefix) {
+		return "", fmt.Errorf("invalid bearer token format")
+	}
+	return hashToken(strings.TrimPrefix(bearerToken, sha256Prefix)), nil
+}
+
+// resolvedToken is what resolveToken derives from a bearer token: the name under
+// which its OAuthAccessToken is stored, plus (unless selfIndexed) the secret still to
+// be verified against the stored hash.
+type resolvedToken struct {
+	name        string
+	secret      string
+	selfIndexed bool
+	reg         hasherRegistration
+}
+
+// resolveToken splits bearerToken into its OAuthAccessToken name using whichever
+// hasher hashers has registered for its prefix. It's the one place that understands
+// every hasher's naming scheme, so lookupToken (which also verifies the secret) and
+// tokenName (which only needs the name, for the cache's revocation index) can't drift
+// out of sync as hashers are added.
+func resolveToken(hashers *TokenHasherRegistry, bearerToken string) (resolvedToken, error) {
+	prefix, remainder, ok := splitTokenPrefix(bearerToken)
+	if !ok {
+		return resolvedToken{}, fmt.Errorf("invalid bearer token format")
+	}
+
+	reg, ok := hashers.lookup(prefix)
+	if !ok {
+		return resolvedToken{}, fmt.Errorf("unrecognized token prefix %q", prefix)
+	}
+
+	if reg.selfIndexed {
+		digest, err := reg.hasher.Hash(remainder)
+		if err != nil {
+			return resolvedToken{}, err
+		}
+		return resolvedToken{name: prefix + digest, secret: remainder, selfIndexed: true, reg: reg}, nil
+	}
+
+	lookupName, secret, found := strings.Cut(remainder, ".")
+	if !found {
+		return resolvedToken{}, fmt.Errorf("invalid bearer token format")
+	}
+	return resolvedToken{name: prefix + lookupName, secret: secret, reg: reg}, nil
+}
+
+// lookupToken resolves bearerToken to its OAuthAccessToken using whichever hasher is
+// registered for the token's prefix, verifying it along the way for hashers (like
+// bcrypt) whose stored value can't simply be recomputed and compared.
+func (a *tokenAuthenticator) lookupToken(ctx context.Context, bearerToken string) (*oauthv1.OAuthAccessToken, error) {
+	resolved, err := resolveToken(a.hashers, bearerToken)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := a.tokens.Get(ctx, resolved.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resolved.selfIndexed {
+		if err := resolved.reg.hasher.Verify(resolved.secret, token.HashedSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	return token, nil
+}
+
+// tokenName implements tokenNamer, letting the cache layer derive a revocation-index
+// name for bearerToken under any hasher registered with a.hashers, not just the
+// self-indexing sha256 scheme getTokenName understands.
+func (a *tokenAuthenticator) tokenName(bearerToken string) (string, error) {
+	resolved, err := resolveToken(a.hashers, bearerToken)
+	if err != nil {
+		return "", err
+	}
+	return resolved.name, nil
+}
+
+// uidValidator rejects tokens whose stored UserUID no longer matches the current UID
+// of the user they named, e.g. because the user was deleted and recreated.
+type uidValidator struct{}
+
+// NewUIDValidator returns an OAuthTokenValidator that enforces OAuthAccessToken.UserUID.
+func NewUIDValidator() OAuthTokenValidator {
+	return uidValidator{}
+}
+
+func (uidValidator) Validate(_ context.Context, token *oauthv1.OAuthAccessToken, u *userv1.User) error {
+	if string(u.UID) != token.UserUID {
+		return fmt.Errorf("user.UID (%s) does not match token.userUID (%s)", u.UID, token.UserUID)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"strconv"
 	"testing"
 	"time"
 
@@ -34,7 +35,7 @@ func TestAuthenticateTokenInvalidUID(t *testing.T) {
 	)
 	fakeUserClient := userfake.NewSimpleClientset(&userv1.User{ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "bar2"}})
 
-	tokenAuthenticator := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, NewUIDValidator())
+	tokenAuthenticator := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, nil, NewUIDValidator())
 
 	userInfo, found, err := tokenAuthenticator.AuthenticateToken(context.TODO(), token)
 	if found {
@@ -74,7 +75,7 @@ func TestAuthenticateTokenFormats(t *testing.T) {
 		&userv1.User{ObjectMeta: metav1.ObjectMeta{Name: "token2User", UID: "token2UserID"}},
 	)
 
-	tokenAuthenticator := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, NewUIDValidator())
+	tokenAuthenticator := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, nil, NewUIDValidator())
 
 	type Test struct {
 		name             string
@@ -114,14 +115,137 @@ func TestAuthenticateTokenFormats(t *testing.T) {
 			if userInfo == nil && len(test.expectedUserName) > 0 {
 				t.Errorf("Got no user info, but expected user name %q", test.expectedUserName)
 			}
+			if found {
+				extra := userInfo.User.GetExtra()
+				if len(extra[issuedAtExtraKey]) != 1 {
+					t.Errorf("Expected a single %s value, got %v", issuedAtExtraKey, extra[issuedAtExtraKey])
+				}
+				if expiresIn := extra[expiresInExtraKey]; len(expiresIn) != 1 {
+					t.Errorf("Expected a single %s value, got %v", expiresInExtraKey, expiresIn)
+				}
+			}
 		})
 	}
 }
 
+func TestAuthenticateTokenExpiresIn(t *testing.T) {
+	t.Run("decreases monotonically as the absolute expiry approaches", func(t *testing.T) {
+		testClock := clock.NewFakeClock(time.Now())
+
+		token, tokenHash := generateOAuthTokenPair()
+		fakeOAuthClient := oauthfake.NewSimpleClientset(
+			&oauthv1.OAuthAccessToken{
+				ObjectMeta: metav1.ObjectMeta{Name: tokenHash, CreationTimestamp: metav1.Time{Time: testClock.Now()}},
+				ExpiresIn:  600,
+				UserName:   "foo",
+				UserUID:    "bar",
+			},
+		)
+		fakeUserClient := userfake.NewSimpleClientset(&userv1.User{ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "bar"}})
+
+		authn := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, nil)
+		authn.(*tokenAuthenticator).clock = testClock
+
+		first := expiresIn(t, authn, token)
+
+		testClock.Step(100 * time.Second)
+		second := expiresIn(t, authn, token)
+
+		if second >= first {
+			t.Errorf("expected expires-in to decrease as the clock advances, got %d then %d", first, second)
+		}
+		if first-second != 100 {
+			t.Errorf("expected expires-in to drop by exactly the elapsed 100 seconds, dropped by %d", first-second)
+		}
+	})
+
+	t.Run("reports the refreshed deadline for a token within its inactivity window", func(t *testing.T) {
+		testClock := clock.NewFakeClock(time.Now())
+
+		const inactivityTimeout = int32(30)
+		client := oauthv1.OAuthClient{
+			ObjectMeta:                          metav1.ObjectMeta{Name: "testClient"},
+			AccessTokenInactivityTimeoutSeconds: &inactivityTimeout,
+		}
+		token, tokenHash := generateOAuthTokenPair()
+		oauthToken := oauthv1.OAuthAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: tokenHash, CreationTimestamp: metav1.Time{Time: testClock.Now()}},
+			ClientName: "testClient",
+			ExpiresIn:  600, // much longer than the inactivity timeout
+			UserName:   "foo",
+			UserUID:    "bar",
+		}
+		fakeOAuthClient := oauthfake.NewSimpleClientset(&oauthToken, &client)
+		fakeUserClient := userfake.NewSimpleClientset(&userv1.User{ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "bar"}})
+		lister := &fakeOAuthClientLister{clients: fakeOAuthClient.OauthV1().OAuthClients()}
+
+		timeouts := NewTimeoutValidator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), lister, inactivityTimeout, inactivityTimeout)
+		timeouts.clock = testClock
+
+		// Validate dispatches putTokenHandler on its own goroutine (see
+		// TimeoutValidator.Validate), so the deadline a call just pushed out can't be
+		// observed by reading the response that same call returns -- that response
+		// races the asynchronous write. Decorate putTokenHandler with a sync channel,
+		// as TestAuthenticateTokenTimeout does, and always read the deadline back
+		// with one extra authentication after waiting on it, so the value under test
+		// reflects a write that's already landed rather than one still in flight.
+		originalPutToken := timeouts.putTokenHandler
+		putTokenSync := make(chan struct{})
+		timeouts.putTokenHandler = func(td *tokenData) {
+			originalPutToken(td)
+			putTokenSync <- struct{}{}
+		}
+
+		authn := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, nil, timeouts)
+		authn.(*tokenAuthenticator).clock = testClock
+
+		expiresIn(t, authn, token) // warms knownTokens; its own return value is racy
+		wait(t, putTokenSync)
+
+		first := expiresIn(t, authn, token)
+		wait(t, putTokenSync)
+		if first != int(inactivityTimeout) {
+			t.Fatalf("expected expires-in to be bounded by the inactivity timeout (%d), got %d", inactivityTimeout, first)
+		}
+
+		// Re-authenticating partway through the window should push the deadline back
+		// out to a full inactivityTimeout from now, rather than letting it keep
+		// counting down from the original authentication.
+		testClock.Step(20 * time.Second)
+		expiresIn(t, authn, token) // warms knownTokens at the new clock value
+		wait(t, putTokenSync)
+
+		second := expiresIn(t, authn, token)
+		wait(t, putTokenSync)
+		if second <= int(inactivityTimeout)-20 {
+			t.Errorf("expected activity to extend the deadline past the %ds naive countdown, got %d", int(inactivityTimeout)-20, second)
+		}
+	})
+}
+
+// expiresIn authenticates token and returns the parsed expiresInExtraKey value,
+// failing the test if authentication fails or the value is missing/malformed.
+func expiresIn(t *testing.T, tokenAuthenticator authenticator.Token, token string) int {
+	t.Helper()
+	userInfo, found, err := tokenAuthenticator.AuthenticateToken(context.TODO(), token)
+	if err != nil || !found {
+		t.Fatalf("expected token to authenticate, found=%v err=%v", found, err)
+	}
+	values := userInfo.User.GetExtra()[expiresInExtraKey]
+	if len(values) != 1 {
+		t.Fatalf("expected a single %s value, got %v", expiresInExtraKey, values)
+	}
+	seconds, err := strconv.Atoi(values[0])
+	if err != nil {
+		t.Fatalf("failed to parse %s value %q: %v", expiresInExtraKey, values[0], err)
+	}
+	return seconds
+}
+
 func TestAuthenticateTokenNotFoundSuppressed(t *testing.T) {
 	fakeOAuthClient := oauthfake.NewSimpleClientset()
 	fakeUserClient := userfake.NewSimpleClientset()
-	tokenAuthenticator := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil)
+	tokenAuthenticator := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, nil)
 
 	userInfo, found, err := tokenAuthenticator.AuthenticateToken(context.TODO(), "sha256~token")
 	if found {
@@ -141,7 +265,7 @@ func TestAuthenticateTokenOtherGetErrorSuppressed(t *testing.T) {
 		return true, nil, errors.New("get error")
 	})
 	fakeUserClient := userfake.NewSimpleClientset()
-	tokenAuthenticator := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil)
+	tokenAuthenticator := NewTokenAuthenticator(fakeOAuthClient.OauthV1().OAuthAccessTokens(), fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, nil)
 
 	userInfo, found, err := tokenAuthenticator.AuthenticateToken(context.TODO(), "sha256~token")
 	if found {
@@ -249,7 +373,10 @@ func TestAuthenticateTokenTimeout(t *testing.T) {
 	// add some padding to all sleep invocations to make sure we are not failing on any boundary values
 	buffer := time.Nanosecond
 
-	tokenAuthenticator := NewTokenAuthenticator(accessTokenGetter, fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, timeouts)
+	authn := NewTokenAuthenticator(accessTokenGetter, fakeUserClient.UserV1().Users(), NoopGroupMapper{}, nil, nil, timeouts)
+	// the tokens' absolute ExpiresIn is checked against the same fake clock
+	authn.(*tokenAuthenticator).clock = testClock
+	tokenAuthenticator := authn
 
 	go timeouts.Run(stopCh)
 
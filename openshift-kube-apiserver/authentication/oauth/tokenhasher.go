@@ -0,0 +1,194 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	oauthv1 "github.com/openshift/api/oauth/v1"
+)
+
+// TokenHasher implements one bearer-token hashing scheme, identified by Prefix. Hash
+// is called at token-creation time to compute the value that gets persisted; Verify
+// checks a presented secret against that persisted value at authentication time.
+//
+// A hasher whose Hash output is reproducible from the secret alone (sha256) lets the
+// OAuthAccessToken be looked up by recomputing its name; one that salts its output
+// (bcrypt) can't guarantee that, so tokens minted under it carry an explicit
+// "<lookupName>.<secret>" pair instead of deriving the lookup name from the secret.
+type TokenHasher interface {
+	// Prefix is prepended to both minted bearer tokens and the OAuthAccessToken
+	// names they produce, e.g. "sha256~".
+	Prefix() string
+	Hash(secret string) (string, error)
+	Verify(secret, stored string) error
+}
+
+type hasherRegistration struct {
+	hasher      TokenHasher
+	selfIndexed bool
+}
+
+// TokenHasherRegistry resolves a TokenHasher by the prefix on a bearer token, so a
+// single authenticator can accept tokens minted under several algorithms at once and
+// a cluster can migrate from one to another incrementally.
+type TokenHasherRegistry struct {
+	hashers map[string]hasherRegistration
+}
+
+// NewTokenHasherRegistry returns a registry with no hashers registered.
+func NewTokenHasherRegistry() *TokenHasherRegistry {
+	return &TokenHasherRegistry{hashers: map[string]hasherRegistration{}}
+}
+
+// DefaultTokenHasherRegistry is used whenever NewTokenAuthenticator is given a nil
+// registry: SHA-256 only, matching this authenticator's original behavior.
+func DefaultTokenHasherRegistry() *TokenHasherRegistry {
+	return NewTokenHasherRegistry().registerSelfIndexed(NewSHA256TokenHasher())
+}
+
+func (r *TokenHasherRegistry) registerSelfIndexed(h TokenHasher) *TokenHasherRegistry {
+	r.hashers[h.Prefix()] = hasherRegistration{hasher: h, selfIndexed: true}
+	return r
+}
+
+// Register adds h to the registry. Only a hasher whose Hash output can be recomputed
+// identically from the secret alone (today, just sha256) may skip this and register
+// as self-indexing instead; every other hasher's tokens pay for an extra lookup-name
+// segment so the OAuthAccessToken can still be found without rehashing.
+func (r *TokenHasherRegistry) Register(h TokenHasher) *TokenHasherRegistry {
+	r.hashers[h.Prefix()] = hasherRegistration{hasher: h}
+	return r
+}
+
+func (r *TokenHasherRegistry) lookup(prefix string) (hasherRegistration, bool) {
+	if r == nil {
+		return hasherRegistration{}, false
+	}
+	reg, ok := r.hashers[prefix]
+	return reg, ok
+}
+
+// splitTokenPrefix splits a bearer token into its "<prefix>~" and the remainder, where
+// prefix includes the trailing "~". Tokens with no "~" have no recognized prefix.
+func splitTokenPrefix(bearerToken string) (prefix, remainder string, ok bool) {
+	idx := strings.Index(bearerToken, "~")
+	if idx < 0 {
+		return "", "", false
+	}
+	return bearerToken[:idx+1], bearerToken[idx+1:], true
+}
+
+// randomLookupName returns a random, URL- and DNS-label-safe identifier, used as the
+// OAuthAccessToken name for hashers that can't derive that name from the secret.
+func randomLookupName() string {
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(randomSecret(20))))
+}
+
+// sha256TokenHasher is the original, fast, constant-time-compared hashing scheme.
+type sha256TokenHasher struct{}
+
+// NewSHA256TokenHasher returns the SHA-256 TokenHasher.
+func NewSHA256TokenHasher() TokenHasher {
+	return sha256TokenHasher{}
+}
+
+func (sha256TokenHasher) Prefix() string {
+	return sha256Prefix
+}
+
+func (sha256TokenHasher) Hash(secret string) (string, error) {
+	return sha256Digest(secret), nil
+}
+
+func (h sha256TokenHasher) Verify(secret, stored string) error {
+	computed, _ := h.Hash(secret)
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(stored)) != 1 {
+		return fmt.Errorf("token does not match")
+	}
+	return nil
+}
+
+// bcryptPrefix marks a bearer token (and the OAuthAccessToken it names) as hashed
+// with bcrypt rather than plain SHA-256.
+const bcryptPrefix = "bcrypt~"
+
+// bcryptTokenHasher hashes secrets with bcrypt, trading authentication latency for
+// making a stolen etcd snapshot's tokens memory-hard (and so slow) to brute force.
+type bcryptTokenHasher struct {
+	cost int
+}
+
+// NewBCryptTokenHasher returns a TokenHasher that hashes secrets with bcrypt at cost.
+func NewBCryptTokenHasher(cost int) TokenHasher {
+	return bcryptTokenHasher{cost: cost}
+}
+
+func (bcryptTokenHasher) Prefix() string {
+	return bcryptPrefix
+}
+
+func (h bcryptTokenHasher) Hash(secret string) (string, error) {
+	sum, err := bcrypt.GenerateFromPassword([]byte(secret), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sum), nil
+}
+
+func (bcryptTokenHasher) Verify(secret, stored string) error {
+	sum, err := base64.RawURLEncoding.DecodeString(stored)
+	if err != nil {
+		return fmt.Errorf("malformed stored bcrypt hash: %w", err)
+	}
+	return bcrypt.CompareHashAndPassword(sum, []byte(secret))
+}
+
+// NewOAuthAccessToken mints a bearer token and the OAuthAccessToken it authenticates
+// against, using the hasher registered under prefix. Whichever hasher issues a token
+// is the one that must later verify it (selected by the token's own prefix), which is
+// how a cluster migrates from one algorithm to another incrementally: point new
+// issuance at the new prefix and old tokens keep working under the one that minted
+// them, until they expire.
+func NewOAuthAccessToken(registry *TokenHasherRegistry, prefix, userName, userUID, clientName string, expiresIn int64) (bearerToken string, token *oauthv1.OAuthAccessToken, err error) {
+	reg, ok := registry.lookup(prefix)
+	if !ok {
+		return "", nil, fmt.Errorf("no hasher registered for token prefix %q", prefix)
+	}
+
+	secret := randomSecret(32)
+
+	if reg.selfIndexed {
+		digest, err := reg.hasher.Hash(secret)
+		if err != nil {
+			return "", nil, err
+		}
+		return prefix + secret, &oauthv1.OAuthAccessToken{
+			ObjectMeta: metav1.ObjectMeta{Name: prefix + digest},
+			UserName:   userName,
+			UserUID:    userUID,
+			ClientName: clientName,
+			ExpiresIn:  expiresIn,
+		}, nil
+	}
+
+	lookupName := randomLookupName()
+	stored, err := reg.hasher.Hash(secret)
+	if err != nil {
+		return "", nil, err
+	}
+	return prefix + lookupName + "." + secret, &oauthv1.OAuthAccessToken{
+		ObjectMeta:   metav1.ObjectMeta{Name: prefix + lookupName},
+		UserName:     userName,
+		UserUID:      userUID,
+		ClientName:   clientName,
+		ExpiresIn:    expiresIn,
+		HashedSecret: stored,
+	}, nil
+}
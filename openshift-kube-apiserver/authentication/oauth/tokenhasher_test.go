@@ -0,0 +1,93 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	userv1 "github.com/openshift/api/user/v1"
+	oauthfake "github.com/openshift/client-go/oauth/clientset/versioned/fake"
+	userfake "github.com/openshift/client-go/user/clientset/versioned/fake"
+)
+
+func TestAuthenticateTokenMixedHashAlgorithms(t *testing.T) {
+	registry := NewTokenHasherRegistry().
+		registerSelfIndexed(NewSHA256TokenHasher())
+	registry.Register(NewBCryptTokenHasher(4)) // lowest valid cost, to keep the test fast
+
+	sha256Bearer, sha256Token, err := NewOAuthAccessToken(registry, sha256Prefix, "sha-user", "sha-uid", "client", 600)
+	if err != nil {
+		t.Fatalf("failed to mint sha256 token: %v", err)
+	}
+	bcryptBearer, bcryptToken, err := NewOAuthAccessToken(registry, bcryptPrefix, "bcrypt-user", "bcrypt-uid", "client", 600)
+	if err != nil {
+		t.Fatalf("failed to mint bcrypt token: %v", err)
+	}
+
+	// The fake client doesn't stamp CreationTimestamp the way the API server would, and
+	// without it ExpiresIn would count from the zero time.
+	sha256Token.CreationTimestamp = metav1.Now()
+	bcryptToken.CreationTimestamp = metav1.Now()
+
+	fakeOAuthClient := oauthfake.NewSimpleClientset(sha256Token, bcryptToken)
+	fakeUserClient := userfake.NewSimpleClientset(
+		&userv1.User{ObjectMeta: metav1.ObjectMeta{Name: "sha-user", UID: "sha-uid"}},
+		&userv1.User{ObjectMeta: metav1.ObjectMeta{Name: "bcrypt-user", UID: "bcrypt-uid"}},
+	)
+
+	tokenAuthenticator := NewTokenAuthenticator(
+		fakeOAuthClient.OauthV1().OAuthAccessTokens(),
+		fakeUserClient.UserV1().Users(),
+		NoopGroupMapper{},
+		nil,
+		registry,
+	)
+
+	for _, tc := range []struct {
+		name             string
+		bearerToken      string
+		expectedUserName string
+	}{
+		{"sha256 token", sha256Bearer, "sha-user"},
+		{"bcrypt token", bcryptBearer, "bcrypt-user"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			userInfo, found, err := tokenAuthenticator.AuthenticateToken(context.TODO(), tc.bearerToken)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !found {
+				t.Fatal("expected token to be found")
+			}
+			if userInfo.User.GetName() != tc.expectedUserName {
+				t.Errorf("expected user %q, got %q", tc.expectedUserName, userInfo.User.GetName())
+			}
+		})
+	}
+
+	// A bcrypt-hashed token's secret re-presented under the sha256 prefix (or vice
+	// versa) must not authenticate: each hasher only ever verifies its own tokens.
+	_, wrongBearer, _ := splitTokenPrefix(bcryptBearer)
+	if _, found, err := tokenAuthenticator.AuthenticateToken(context.TODO(), sha256Prefix+wrongBearer); found || err == nil {
+		t.Errorf("expected cross-algorithm token to be rejected, found=%v err=%v", found, err)
+	}
+}
+
+func TestTokenHasherRegistryRejectsUnknownPrefix(t *testing.T) {
+	registry := DefaultTokenHasherRegistry()
+
+	fakeOAuthClient := oauthfake.NewSimpleClientset()
+	fakeUserClient := userfake.NewSimpleClientset()
+	tokenAuthenticator := NewTokenAuthenticator(
+		fakeOAuthClient.OauthV1().OAuthAccessTokens(),
+		fakeUserClient.UserV1().Users(),
+		NoopGroupMapper{},
+		nil,
+		registry,
+	)
+
+	if _, found, err := tokenAuthenticator.AuthenticateToken(context.TODO(), "bcrypt~nolookup.nosecret"); found || err == nil {
+		t.Errorf("expected a token under an unregistered prefix to be rejected, found=%v err=%v", found, err)
+	}
+}
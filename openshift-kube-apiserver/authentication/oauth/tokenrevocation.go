@@ -0,0 +1,34 @@
+package oauth
+
+import (
+	"k8s.io/client-go/tools/cache"
+
+	oauthv1 "github.com/openshift/api/oauth/v1"
+	oauthinformers "github.com/openshift/client-go/informers/externalversions/oauth/v1"
+)
+
+// RegisterTokenRevocationHandler wires revoker up to informer's delete events so a
+// deleted OAuthAccessToken is synchronously evicted from the cache rather than
+// lingering until its entry's TTL elapses. This is what lets a logout handler, an
+// admin "kill this session" endpoint, or the OAuthAccessToken GC controller -- all of
+// which delete the OAuthAccessToken -- take effect on the very next request across
+// every authenticator instance in the process, instead of up to successTTL/failureTTL
+// later.
+func RegisterTokenRevocationHandler(informer oauthinformers.OAuthAccessTokenInformer, revoker TokenRevoker) {
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			token, ok := obj.(*oauthv1.OAuthAccessToken)
+			if !ok {
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					return
+				}
+				token, ok = tombstone.Obj.(*oauthv1.OAuthAccessToken)
+				if !ok {
+					return
+				}
+			}
+			revoker.ExpireToken(token.Name)
+		},
+	})
+}
@@ -0,0 +1,205 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/clock"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	oauthv1 "github.com/openshift/api/oauth/v1"
+	userv1 "github.com/openshift/api/user/v1"
+	oauthclient "github.com/openshift/client-go/oauth/clientset/versioned/typed/oauth/v1"
+)
+
+// OAuthClientLister resolves the OAuthClient that issued a token, so the
+// TimeoutValidator can read its configured inactivity timeout.
+type OAuthClientLister interface {
+	Get(name string) (*oauthv1.OAuthClient, error)
+	List(selector labels.Selector) ([]*oauthv1.OAuthClient, error)
+}
+
+// tokenData is the in-memory record of a token whose inactivity deadline has been
+// refreshed locally and is waiting to be persisted back to its OAuthAccessToken.
+type tokenData struct {
+	token   *oauthv1.OAuthAccessToken
+	timeout int32
+	flushAt time.Time
+}
+
+// TimeoutValidator is an OAuthTokenValidator that enforces per-client inactivity
+// timeouts on OAuthAccessTokens and periodically flushes the extended deadline back
+// to the stored token, so a restarted apiserver doesn't immediately time tokens out.
+//
+// Every successful authentication bumps the token's deadline in memory; writes to
+// etcd are batched on a ticker rather than done on every request, with an emergency
+// flush triggered whenever a token's new deadline falls inside the next tick.
+type TimeoutValidator struct {
+	tokens  oauthclient.OAuthAccessTokenInterface
+	clients OAuthClientLister
+
+	defaultTimeoutSeconds int32
+	minTimeoutSeconds     int32
+
+	clock clock.Clock
+
+	lock        sync.Mutex
+	knownTokens map[string]*tokenData
+
+	// flushHandler and putTokenHandler are overridable hooks so tests can observe
+	// (and deterministically wait on) each flush/put cycle.
+	flushHandler    func(flushHorizon time.Time)
+	putTokenHandler func(td *tokenData)
+}
+
+// NewTimeoutValidator returns a TimeoutValidator. defaultTimeoutSeconds is used for
+// OAuthClients that don't set AccessTokenInactivityTimeoutSeconds; minTimeoutSeconds
+// is the smallest inactivity timeout any client may configure and also determines how
+// often pending deadline extensions are flushed to etcd (minTimeoutSeconds/3).
+func NewTimeoutValidator(tokens oauthclient.OAuthAccessTokenInterface, clients OAuthClientLister, defaultTimeoutSeconds, minTimeoutSeconds int32) *TimeoutValidator {
+	v := &TimeoutValidator{
+		tokens:                tokens,
+		clients:               clients,
+		defaultTimeoutSeconds: defaultTimeoutSeconds,
+		minTimeoutSeconds:     minTimeoutSeconds,
+		clock:                 clock.RealClock{},
+		knownTokens:           map[string]*tokenData{},
+	}
+	v.flushHandler = v.flush
+	v.putTokenHandler = v.putToken
+	return v
+}
+
+// Run periodically flushes pending deadline extensions until stopCh is closed.
+func (v *TimeoutValidator) Run(stopCh <-chan struct{}) {
+	tick := v.tickInterval()
+	ticker := v.clock.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			v.flushHandler(v.clock.Now())
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (v *TimeoutValidator) tickInterval() time.Duration {
+	interval := time.Duration(v.minTimeoutSeconds) * time.Second / 3
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return interval
+}
+
+// Validate implements OAuthTokenValidator.
+func (v *TimeoutValidator) Validate(_ context.Context, token *oauthv1.OAuthAccessToken, _ *userv1.User) error {
+	timeout, err := v.effectiveTimeout(token)
+	if err != nil {
+		return err
+	}
+
+	now := v.clock.Now()
+
+	if timeout == 0 {
+		if token.InactivityTimeoutSeconds != 0 {
+			go v.putTokenHandler(&tokenData{token: token, timeout: 0, flushAt: now})
+		}
+		return nil
+	}
+
+	if now.After(v.deadline(token)) {
+		return errTimedout
+	}
+
+	go v.putTokenHandler(&tokenData{token: token, timeout: timeout, flushAt: now.Add(time.Duration(timeout) * time.Second)})
+	return nil
+}
+
+// effectiveDeadline implements deadlineScoper, letting AuthenticateToken report an
+// accurate expires-in value without duplicating Validate's accept/reject logic.
+func (v *TimeoutValidator) effectiveDeadline(token *oauthv1.OAuthAccessToken) (time.Time, bool) {
+	timeout, err := v.effectiveTimeout(token)
+	if err != nil || timeout == 0 {
+		return time.Time{}, false
+	}
+	return v.deadline(token), true
+}
+
+var _ deadlineScoper = (*TimeoutValidator)(nil)
+
+// deadline returns the moment at which token will time out absent further activity,
+// preferring a deadline extension already recorded in memory over the last one
+// persisted to etcd.
+func (v *TimeoutValidator) deadline(token *oauthv1.OAuthAccessToken) time.Time {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if td, ok := v.knownTokens[token.Name]; ok && td.timeout > 0 {
+		return td.flushAt
+	}
+	return token.CreationTimestamp.Add(time.Duration(token.InactivityTimeoutSeconds) * time.Second)
+}
+
+// effectiveTimeout resolves the inactivity timeout that applies to token, given its
+// issuing OAuthClient's configuration.
+func (v *TimeoutValidator) effectiveTimeout(token *oauthv1.OAuthAccessToken) (int32, error) {
+	client, err := v.clients.Get(token.ClientName)
+	if err != nil {
+		return 0, fmt.Errorf("could not get client for token: %w", err)
+	}
+
+	switch {
+	case client.AccessTokenInactivityTimeoutSeconds == nil:
+		return v.defaultTimeoutSeconds, nil
+	case *client.AccessTokenInactivityTimeoutSeconds == 0:
+		return 0, nil
+	case *client.AccessTokenInactivityTimeoutSeconds < v.minTimeoutSeconds:
+		return v.minTimeoutSeconds, nil
+	default:
+		return *client.AccessTokenInactivityTimeoutSeconds, nil
+	}
+}
+
+func (v *TimeoutValidator) putToken(td *tokenData) {
+	v.lock.Lock()
+	v.knownTokens[td.token.Name] = td
+	v.lock.Unlock()
+
+	if td.flushAt.Sub(v.clock.Now()) <= v.tickInterval() {
+		v.flushHandler(v.clock.Now())
+	}
+}
+
+// flush persists every pending deadline extension whose flushAt has arrived.
+func (v *TimeoutValidator) flush(flushHorizon time.Time) {
+	v.lock.Lock()
+	due := make([]*tokenData, 0, len(v.knownTokens))
+	for name, td := range v.knownTokens {
+		if !td.flushAt.After(flushHorizon) {
+			due = append(due, td)
+			delete(v.knownTokens, name)
+		}
+	}
+	v.lock.Unlock()
+
+	for _, td := range due {
+		current, err := v.tokens.Get(context.Background(), td.token.Name, metav1.GetOptions{})
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("failed to refresh inactivity timeout for token: %w", err))
+			continue
+		}
+		current.InactivityTimeoutSeconds = 0
+		if td.timeout > 0 {
+			// Stored as seconds since creation, which is how deadline reads it back.
+			current.InactivityTimeoutSeconds = int32(td.flushAt.Sub(current.CreationTimestamp.Time) / time.Second)
+		}
+		if _, err := v.tokens.Update(context.Background(), current, metav1.UpdateOptions{}); err != nil {
+			utilruntime.HandleError(fmt.Errorf("failed to persist inactivity timeout for token: %w", err))
+		}
+	}
+}